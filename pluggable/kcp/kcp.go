@@ -0,0 +1,153 @@
+// Package kcp implements a pluggable.Transport that tunnels the OpenVPN
+// TCP stream over a KCP (reliable-UDP) session, via xtaci/kcp-go. Like
+// the quic carrier, this helps on networks that throttle long-lived TCP
+// flows but pass UDP.
+package kcp
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	kcpgo "github.com/xtaci/kcp-go"
+
+	"ivpn/daemon/logger"
+)
+
+var log *logger.Logger
+
+func init() {
+	log = logger.NewLogger("kcp")
+}
+
+// Client is a KCP carrier for the OpenVPN TCP stream: every connection
+// accepted on its local Listener is proxied to remoteAddr over its own
+// KCP session.
+//
+// Client implements pluggable.Transport.
+type Client struct {
+	Listener net.Listener
+
+	presharedKey []byte
+
+	closeOnce sync.Once
+	stopped   chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewClient creates a KCP transport client. presharedKey, when non-empty,
+// is used to derive the block cipher shared with the server.
+func NewClient(presharedKey []byte) *Client {
+	return &Client{presharedKey: presharedKey}
+}
+
+// Start binds a local listener on 127.0.0.1:0 and starts proxying every
+// accepted connection to remoteAddr over its own KCP session.
+func (c *Client) Start(remoteAddr string) error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to start kcp carrier listener: %w", err)
+	}
+
+	c.Listener = ln
+	c.stopped = make(chan struct{})
+
+	c.wg.Add(1)
+	go c.acceptLoop(remoteAddr)
+
+	return nil
+}
+
+// ListenAddress returns the local address OpenVPN should dial.
+func (c *Client) ListenAddress() net.Addr {
+	if c.Listener == nil {
+		return nil
+	}
+	return c.Listener.Addr()
+}
+
+func (c *Client) acceptLoop(remoteAddr string) {
+	defer c.wg.Done()
+
+	for {
+		conn, err := c.Listener.Accept()
+		if err != nil {
+			select {
+			case <-c.stopped:
+				return
+			default:
+				log.Error("kcp carrier accept error: ", err)
+				return
+			}
+		}
+
+		c.wg.Add(1)
+		go c.serve(conn, remoteAddr)
+	}
+}
+
+func (c *Client) serve(local net.Conn, remoteAddr string) {
+	defer c.wg.Done()
+	defer local.Close()
+
+	block, err := c.blockCrypt()
+	if err != nil {
+		log.Error("failed to derive kcp block cipher: ", err)
+		return
+	}
+
+	sess, err := kcpgo.DialWithOptions(remoteAddr, block, 10, 3)
+	if err != nil {
+		log.Error("failed to dial kcp session: ", err)
+		return
+	}
+	defer sess.Close()
+
+	var pipeWG sync.WaitGroup
+	pipeWG.Add(2)
+	go func() {
+		defer pipeWG.Done()
+		io.Copy(sess, local)
+	}()
+	go func() {
+		defer pipeWG.Done()
+		io.Copy(local, sess)
+	}()
+	pipeWG.Wait()
+}
+
+// blockCrypt derives the AES block cipher shared with the server from
+// presharedKey, or returns a nil BlockCrypt (no encryption) if none was
+// configured.
+func (c *Client) blockCrypt() (kcpgo.BlockCrypt, error) {
+	if len(c.presharedKey) == 0 {
+		return nil, nil
+	}
+
+	key := sha256.Sum256(c.presharedKey)
+	block, err := kcpgo.NewAESBlockCrypt(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kcp block cipher: %w", err)
+	}
+	return block, nil
+}
+
+// Stop closes the listener, waiting for all in-flight sessions to unwind.
+func (c *Client) Stop() error {
+	c.closeOnce.Do(func() {
+		if c.stopped != nil {
+			close(c.stopped)
+		}
+	})
+
+	if c.Listener != nil {
+		if err := c.Listener.Close(); err != nil {
+			return fmt.Errorf("failed to close kcp carrier listener: %w", err)
+		}
+	}
+
+	c.wg.Wait()
+	return nil
+}
@@ -0,0 +1,138 @@
+package kcp
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	kcpgo "github.com/xtaci/kcp-go"
+)
+
+// startKCPEchoServer starts a loopback KCP listener that echoes back
+// everything it reads on every accepted session, encrypted with the
+// block cipher derived from presharedKey (the same derivation Client
+// uses), or unencrypted if presharedKey is nil.
+func startKCPEchoServer(t *testing.T, presharedKey []byte) *kcpgo.Listener {
+	t.Helper()
+
+	block, err := (&Client{presharedKey: presharedKey}).blockCrypt()
+	if err != nil {
+		t.Fatalf("failed to derive block cipher: %v", err)
+	}
+
+	ln, err := kcpgo.ListenWithOptions("127.0.0.1:0", block, 10, 3)
+	if err != nil {
+		t.Fatalf("failed to start kcp echo server: %v", err)
+	}
+
+	go func() {
+		for {
+			sess, err := ln.AcceptKCP()
+			if err != nil {
+				return
+			}
+			go func(s *kcpgo.UDPSession) {
+				defer s.Close()
+				buf := make([]byte, 1024)
+				for {
+					n, err := s.Read(buf)
+					if err != nil {
+						return
+					}
+					if _, err := s.Write(buf[:n]); err != nil {
+						return
+					}
+				}
+			}(sess)
+		}
+	}()
+
+	return ln
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	echoLn := startKCPEchoServer(t, nil)
+	defer echoLn.Close()
+
+	c := NewClient(nil)
+	if err := c.Start(echoLn.Addr().String()); err != nil {
+		t.Fatalf("client Start failed: %v", err)
+	}
+	defer c.Stop()
+
+	conn, err := net.DialTimeout("tcp", c.ListenAddress().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to dial kcp client listener: %v", err)
+	}
+	defer conn.Close()
+
+	want := "hello through kcp\n"
+	if _, err := conn.Write([]byte(want)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	got, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if got != want {
+		t.Fatalf("round trip mismatch: got %q want %q", got, want)
+	}
+}
+
+func TestClientRoundTripWithMatchingPresharedKey(t *testing.T) {
+	echoLn := startKCPEchoServer(t, []byte("shared-secret"))
+	defer echoLn.Close()
+
+	c := NewClient([]byte("shared-secret"))
+	if err := c.Start(echoLn.Addr().String()); err != nil {
+		t.Fatalf("client Start failed: %v", err)
+	}
+	defer c.Stop()
+
+	conn, err := net.DialTimeout("tcp", c.ListenAddress().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to dial kcp client listener: %v", err)
+	}
+	defer conn.Close()
+
+	want := "hello through encrypted kcp\n"
+	if _, err := conn.Write([]byte(want)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	got, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if got != want {
+		t.Fatalf("round trip mismatch: got %q want %q", got, want)
+	}
+}
+
+func TestClientRoundTripFailsWithMismatchedPresharedKey(t *testing.T) {
+	echoLn := startKCPEchoServer(t, []byte("server-secret"))
+	defer echoLn.Close()
+
+	c := NewClient([]byte("client-secret"))
+	if err := c.Start(echoLn.Addr().String()); err != nil {
+		t.Fatalf("client Start failed: %v", err)
+	}
+	defer c.Stop()
+
+	conn, err := net.DialTimeout("tcp", c.ListenAddress().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to dial kcp client listener: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("hello through encrypted kcp\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+		t.Fatal("expected round trip to fail with mismatched preshared keys")
+	}
+}
@@ -0,0 +1,176 @@
+// Package obfs4 implements an in-process obfs4 pluggable-transport client,
+// built on goptlib and the Tor Project's obfs4 transport implementation.
+// It replaces the external Python obfsproxy process with a plain
+// net.Listener that OpenVPN can dial (and select-close) like any other
+// local socket.
+package obfs4
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	pt "git.torproject.org/pluggable-transports/goptlib.git"
+	"git.torproject.org/pluggable-transports/obfs4.git/transports/base"
+	"git.torproject.org/pluggable-transports/obfs4.git/transports/obfs4"
+
+	"ivpn/daemon/logger"
+)
+
+var log *logger.Logger
+
+func init() {
+	log = logger.NewLogger("obfs4")
+}
+
+// BridgeParams holds the per-gateway obfs4 bridge-line parameters needed
+// to dial it (the "cert=...,iat-mode=..." part of a bridge line).
+type BridgeParams struct {
+	Cert      string
+	IatMode   string
+	NodeID    string
+	PublicKey string
+}
+
+// Client is an in-process obfs4 pluggable-transport client. It exposes a
+// local TCP Listener: every connection accepted on it is wrapped with the
+// obfs4 protocol and proxied to the remote OpenVPN endpoint it was
+// constructed with.
+//
+// Client implements pluggable.Transport.
+type Client struct {
+	Listener net.Listener
+
+	params BridgeParams
+
+	factory base.ClientFactory
+	args    interface{}
+
+	closeOnce sync.Once
+	stopped   chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewClient creates an obfs4 client for the given bridge parameters. Call
+// Start to bind the local listener and begin accepting connections.
+func NewClient(params BridgeParams) *Client {
+	return &Client{params: params}
+}
+
+// Start binds a local listener on 127.0.0.1:0, parses c.params into the
+// obfs4 transport's argument form and starts accepting connections,
+// wrapping each one with obfs4 and dialing remoteAddr through it.
+func (c *Client) Start(remoteAddr string) error {
+	t := &obfs4.Transport{}
+
+	cf, err := t.ClientFactory(os.TempDir())
+	if err != nil {
+		return fmt.Errorf("failed to create obfs4 client factory: %w", err)
+	}
+
+	var ptArgs pt.Args
+	ptArgs.Add("cert", c.params.Cert)
+	ptArgs.Add("iat-mode", c.params.IatMode)
+	if c.params.NodeID != "" {
+		ptArgs.Add("node-id", c.params.NodeID)
+	}
+	if c.params.PublicKey != "" {
+		ptArgs.Add("public-key", c.params.PublicKey)
+	}
+
+	args, err := cf.ParseArgs(&ptArgs)
+	if err != nil {
+		return fmt.Errorf("failed to parse obfs4 bridge parameters: %w", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to start obfs4 listener: %w", err)
+	}
+
+	c.Listener = ln
+	c.factory = cf
+	c.args = args
+	c.stopped = make(chan struct{})
+
+	c.wg.Add(1)
+	go c.acceptLoop(remoteAddr)
+
+	return nil
+}
+
+// ListenAddress returns the local address OpenVPN should dial (e.g. to
+// fill in 'socks-proxy 127.0.0.1 <port>').
+func (c *Client) ListenAddress() net.Addr {
+	if c.Listener == nil {
+		return nil
+	}
+	return c.Listener.Addr()
+}
+
+func (c *Client) acceptLoop(remoteAddr string) {
+	defer c.wg.Done()
+
+	for {
+		conn, err := c.Listener.Accept()
+		if err != nil {
+			select {
+			case <-c.stopped:
+				return // Stop() closed the listener, this is expected
+			default:
+				log.Error("obfs4 accept error: ", err)
+				return
+			}
+		}
+
+		c.wg.Add(1)
+		go c.serve(conn, remoteAddr)
+	}
+}
+
+// serve wraps a single accepted connection with obfs4 and pipes it to
+// remoteAddr until either side closes.
+func (c *Client) serve(local net.Conn, remoteAddr string) {
+	defer c.wg.Done()
+	defer local.Close()
+
+	remote, err := c.factory.Dial("tcp", remoteAddr, net.Dial, c.args)
+	if err != nil {
+		log.Error("obfs4 dial to ", remoteAddr, " failed: ", err)
+		return
+	}
+	defer remote.Close()
+
+	var pipeWG sync.WaitGroup
+	pipeWG.Add(2)
+	go func() {
+		defer pipeWG.Done()
+		io.Copy(remote, local)
+	}()
+	go func() {
+		defer pipeWG.Done()
+		io.Copy(local, remote)
+	}()
+	pipeWG.Wait()
+}
+
+// Stop closes the listener and waits for all in-flight connections to
+// finish unwinding. Safe to call on a client that was never started.
+func (c *Client) Stop() error {
+	c.closeOnce.Do(func() {
+		if c.stopped != nil {
+			close(c.stopped)
+		}
+	})
+
+	if c.Listener != nil {
+		if err := c.Listener.Close(); err != nil {
+			return fmt.Errorf("failed to close obfs4 listener: %w", err)
+		}
+	}
+
+	c.wg.Wait()
+	return nil
+}
@@ -0,0 +1,155 @@
+package obfs4
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	pt "git.torproject.org/pluggable-transports/goptlib.git"
+	"git.torproject.org/pluggable-transports/obfs4.git/transports/obfs4"
+)
+
+// startEchoServer starts a plain TCP echo listener and returns it.
+func startEchoServer(t *testing.T) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start echo server: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				buf := make([]byte, 1024)
+				for {
+					n, err := c.Read(buf)
+					if err != nil {
+						return
+					}
+					if _, err := c.Write(buf[:n]); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return ln
+}
+
+// startObfs4Server wraps echoAddr behind an obfs4 server listener and
+// returns the listener along with the bridge parameters a client needs to
+// reach it.
+func startObfs4Server(t *testing.T, echoAddr string) (net.Listener, BridgeParams) {
+	t.Helper()
+
+	t.Logf("serving obfs4 in front of %s", echoAddr)
+
+	st := &obfs4.Transport{}
+	sf, err := st.ServerFactory(t.TempDir(), &pt.Args{})
+	if err != nil {
+		t.Fatalf("failed to create obfs4 server factory: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start obfs4 listener: %v", err)
+	}
+
+	args := sf.Args()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(c net.Conn) {
+				wrapped, err := sf.WrapConn(c)
+				if err != nil {
+					c.Close()
+					return
+				}
+				defer wrapped.Close()
+
+				upstream, err := net.Dial("tcp", echoAddr)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+
+				go func() {
+					buf := make([]byte, 1024)
+					for {
+						n, err := wrapped.Read(buf)
+						if err != nil {
+							return
+						}
+						if _, err := upstream.Write(buf[:n]); err != nil {
+							return
+						}
+					}
+				}()
+
+				buf := make([]byte, 1024)
+				for {
+					n, err := upstream.Read(buf)
+					if err != nil {
+						return
+					}
+					if _, err := wrapped.Write(buf[:n]); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	params := BridgeParams{
+		Cert:    (*args)["cert"][0],
+		IatMode: "0",
+	}
+
+	return ln, params
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	echoLn := startEchoServer(t)
+	defer echoLn.Close()
+
+	obfsLn, params := startObfs4Server(t, echoLn.Addr().String())
+	defer obfsLn.Close()
+
+	c := NewClient(params)
+	if err := c.Start(obfsLn.Addr().String()); err != nil {
+		t.Fatalf("client Start failed: %v", err)
+	}
+	defer c.Stop()
+
+	conn, err := net.DialTimeout("tcp", c.ListenAddress().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to dial obfs4 client listener: %v", err)
+	}
+	defer conn.Close()
+
+	want := "hello through obfs4\n"
+	if _, err := conn.Write([]byte(want)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	got, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if got != want {
+		t.Fatalf("round trip mismatch: got %q want %q", got, want)
+	}
+}
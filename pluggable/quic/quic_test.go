@@ -0,0 +1,140 @@
+package quic
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// generateSelfSignedTLSConfig creates a throwaway cert for the loopback
+// QUIC server used in the tests below, along with its SHA-256
+// fingerprint for pinning.
+func generateSelfSignedTLSConfig(t *testing.T) (*tls.Config, []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{SerialNumber: big.NewInt(1)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	cert := tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+
+	fingerprint := sha256.Sum256(der)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"ivpn-quic"},
+	}, fingerprint[:]
+}
+
+// startQUICEchoServer starts a loopback QUIC listener that echoes back
+// everything it reads on every accepted stream, and returns the SHA-256
+// fingerprint of the certificate it serves.
+func startQUICEchoServer(t *testing.T) (*quic.Listener, []byte) {
+	t.Helper()
+
+	tlsConf, fingerprint := generateSelfSignedTLSConfig(t)
+	ln, err := quic.ListenAddr("127.0.0.1:0", tlsConf, nil)
+	if err != nil {
+		t.Fatalf("failed to start quic echo server: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func(c quic.Connection) {
+				for {
+					stream, err := c.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					go func(s quic.Stream) {
+						defer s.Close()
+						buf := make([]byte, 1024)
+						for {
+							n, err := s.Read(buf)
+							if err != nil {
+								return
+							}
+							if _, err := s.Write(buf[:n]); err != nil {
+								return
+							}
+						}
+					}(stream)
+				}
+			}(conn)
+		}
+	}()
+
+	return ln, fingerprint
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	echoLn, fingerprint := startQUICEchoServer(t)
+	defer echoLn.Close()
+
+	c := NewClient(fingerprint)
+	if err := c.Start(echoLn.Addr().String()); err != nil {
+		t.Fatalf("client Start failed: %v", err)
+	}
+	defer c.Stop()
+
+	conn, err := net.DialTimeout("tcp", c.ListenAddress().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to dial quic client listener: %v", err)
+	}
+	defer conn.Close()
+
+	want := "hello through quic\n"
+	if _, err := conn.Write([]byte(want)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	got, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if got != want {
+		t.Fatalf("round trip mismatch: got %q want %q", got, want)
+	}
+}
+
+func TestClientRejectsMismatchedCertificate(t *testing.T) {
+	echoLn, _ := startQUICEchoServer(t)
+	defer echoLn.Close()
+
+	wrongFingerprint := sha256.Sum256([]byte("not the server's certificate"))
+
+	c := NewClient(wrongFingerprint[:])
+	err := c.Start(echoLn.Addr().String())
+	if err == nil {
+		c.Stop()
+		t.Fatal("expected Start to fail against a certificate that doesn't match the pinned fingerprint")
+	}
+	if !strings.Contains(err.Error(), "fingerprint mismatch") {
+		t.Fatalf("expected a fingerprint mismatch error, got: %v", err)
+	}
+}
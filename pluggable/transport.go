@@ -0,0 +1,27 @@
+// Package pluggable defines the abstraction OpenVPN uses to tunnel its
+// control connection through a pluggable transport (obfs4, QUIC, KCP, and
+// future siblings such as obfs3, meek or snowflake) instead of talking to the
+// remote gateway directly.
+package pluggable
+
+import "net"
+
+// Transport is implemented by every pluggable-transport client. OpenVPN
+// starts at most one Transport per connection attempt (none for a direct
+// connection), points its
+// '--socks-proxy' (or equivalent) option at ListenAddress(), and never
+// talks to the remote gateway by any other route.
+type Transport interface {
+	// Start binds a local listener and begins wrapping every accepted
+	// connection with the transport before forwarding it to remoteAddr.
+	// It returns once the listener is ready to accept connections.
+	Start(remoteAddr string) error
+
+	// Stop closes the listener and releases all transport resources.
+	// It is safe to call Stop on a transport that was never started.
+	Stop() error
+
+	// ListenAddress returns the local address OpenVPN should connect
+	// through. It is only valid after a successful Start.
+	ListenAddress() net.Addr
+}
@@ -0,0 +1,138 @@
+package openvpn
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"ivpn/daemon/pluggable/obfs4"
+)
+
+// ObfuscationMode selects which pluggable.Transport (if any) OpenVPN
+// should route its traffic through.
+type ObfuscationMode int
+
+// Supported obfuscation modes. None means connect directly.
+const (
+	None ObfuscationMode = iota
+	Obfs4
+	QUIC
+	KCP
+)
+
+// ConnectionParams contains all data required to establish a single
+// OpenVPN connection: the candidate gateway addresses, credentials and
+// (optionally) the obfuscation transport parameters needed to reach a
+// blocked gateway.
+type ConnectionParams struct {
+	username string
+	password string
+
+	hostIPs      []net.IP
+	proxyAddress net.IP
+	// Port is the real OpenVPN server port on hostIPs, written into the
+	// 'remote' directive for direct (non-obfuscated) connections.
+	Port int
+
+	// ObfuscationMode selects the transport used to reach hostIPs.
+	ObfuscationMode ObfuscationMode
+
+	// ObfsBridge holds the obfs4 bridge parameters. Only meaningful
+	// when ObfuscationMode is Obfs4.
+	ObfsBridge *obfs4.BridgeParams
+	// KCPPresharedKey, when set, is used to derive the KCP block
+	// cipher shared with the server. Only meaningful when
+	// ObfuscationMode is KCP.
+	KCPPresharedKey []byte
+	// QUICServerCertSHA256 pins the QUIC carrier's TLS session to a
+	// known server certificate fingerprint. Only meaningful when
+	// ObfuscationMode is QUIC.
+	QUICServerCertSHA256 []byte
+	// ObfsRemotePort is the gateway's obfuscation-listener port, dialed
+	// by the pluggable transport instead of Port. Only meaningful when
+	// ObfuscationMode is not None.
+	ObfsRemotePort int
+
+	// Fallbacks are additional candidate endpoints tried, in order, if
+	// hostIPs can't be reached (e.g. a blocked obfs4 bridge). The
+	// reconnect loop in OpenVPN.Connect iterates hostIPs then Fallbacks.
+	Fallbacks []Endpoint
+}
+
+// Endpoint is a single candidate gateway the reconnect loop can fail
+// over to: an address/port plus the obfuscation transport (if any)
+// needed to reach it.
+type Endpoint struct {
+	Host net.IP
+	// Port is the real OpenVPN server port, written into the 'remote'
+	// directive for direct (non-obfuscated) connections.
+	Port int
+
+	ObfuscationMode ObfuscationMode
+	// ObfsRemotePort is the gateway's obfuscation-listener port, dialed
+	// by the pluggable transport instead of Port. Only meaningful when
+	// ObfuscationMode is not None.
+	ObfsRemotePort       int
+	ObfsBridge           *obfs4.BridgeParams
+	KCPPresharedKey      []byte
+	QUICServerCertSHA256 []byte
+}
+
+// NewConnectionParams creates connection parameters for a direct
+// connection to port on one of hostIPs.
+func NewConnectionParams(username, password string, hostIPs []net.IP, port int, proxyAddress net.IP) ConnectionParams {
+	return ConnectionParams{
+		username:     username,
+		password:     password,
+		hostIPs:      hostIPs,
+		Port:         port,
+		proxyAddress: proxyAddress,
+	}
+}
+
+// WriteConfigFile generates the OpenVPN configuration file used for this
+// connection attempt. remoteHost/remotePort is the candidate gateway,
+// written as the 'remote' directive when localProxyPort is zero; when
+// localProxyPort is non-zero a 'socks-proxy 127.0.0.1 <localProxyPort>'
+// directive is written in its place.
+func (c *ConnectionParams) WriteConfigFile(configPath string, miIP net.IP, miPort int, logFile string, remoteHost net.IP, remotePort int, localProxyPort int, extraParameters string) error {
+	f, err := os.Create(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to create configuration file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "management %s %d\n", miIP.String(), miPort); err != nil {
+		return fmt.Errorf("failed to write configuration file: %w", err)
+	}
+	// ManagementInterface listens and waits for OpenVPN to connect to it,
+	// so OpenVPN must be told to dial out as the client; otherwise it
+	// tries to bind miIP:miPort itself, which our listener already holds.
+	if _, err := fmt.Fprintln(f, "management-client"); err != nil {
+		return fmt.Errorf("failed to write configuration file: %w", err)
+	}
+
+	if localProxyPort != 0 {
+		if _, err := fmt.Fprintf(f, "socks-proxy 127.0.0.1 %d\n", localProxyPort); err != nil {
+			return fmt.Errorf("failed to write configuration file: %w", err)
+		}
+	} else {
+		if _, err := fmt.Fprintf(f, "remote %s %d\n", remoteHost.String(), remotePort); err != nil {
+			return fmt.Errorf("failed to write configuration file: %w", err)
+		}
+	}
+
+	if logFile != "" {
+		if _, err := fmt.Fprintf(f, "log %s\n", logFile); err != nil {
+			return fmt.Errorf("failed to write configuration file: %w", err)
+		}
+	}
+
+	if extraParameters != "" {
+		if _, err := fmt.Fprintln(f, extraParameters); err != nil {
+			return fmt.Errorf("failed to write configuration file: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package openvpn
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// EventKind identifies the kind of an asynchronous notification received
+// on the OpenVPN management interface (the tag of a ">TAG:body" line).
+type EventKind string
+
+// Event kinds emitted by OpenVPN's management interface. See the
+// "Notification" section of OpenVPN's management-notes.txt.
+const (
+	EventState     EventKind = "STATE"
+	EventBytecount EventKind = "BYTECOUNT"
+	EventHold      EventKind = "HOLD"
+	EventPassword  EventKind = "PASSWORD"
+	EventLog       EventKind = "LOG"
+	EventEcho      EventKind = "ECHO"
+	EventInfo      EventKind = "INFO"
+)
+
+// Event is a single parsed asynchronous notification.
+type Event struct {
+	Kind EventKind
+	Body string
+}
+
+// ManagementInterface talks to the OpenVPN process over its management
+// socket. It demultiplexes every line the process sends: lines starting
+// with '>' are parsed into typed Events and routed to subscribers
+// registered via Subscribe; every other line is treated as a synchronous
+// command reply and delivered on replyChan, where sendAndWait() reads it.
+type ManagementInterface struct {
+	listener net.Listener
+	conn     net.Conn
+
+	username string
+	password string
+
+	routeAddCommands []string
+
+	subsMutex sync.Mutex
+	subs      map[EventKind][]chan Event
+
+	// cmdMutex guards conn and serializes sendAndWait's command/reply
+	// exchanges, so only one sendAndWait waits for a reply at a time.
+	// send() holds it only to read conn and does not wait for a reply.
+	cmdMutex  sync.Mutex
+	replyChan chan string
+
+	middlewares []ManagementMiddleware
+
+	wg sync.WaitGroup
+}
+
+// StartManagementInterface starts listening for the OpenVPN process's
+// management-interface connection and begins demultiplexing it on a
+// background goroutine. Subscribe to the event kinds you care about
+// before the OpenVPN process connects, e.g. with Subscribe(EventState).
+//
+// Each middleware's Start is called (in registration order) once the
+// OpenVPN process has connected, before any line is read from the
+// socket; every line read is then offered to the chain, in registration
+// order, before the built-in demuxer sees it. Middlewares are stopped in
+// reverse registration order when the management interface stops.
+func StartManagementInterface(username string, password string, middlewares ...ManagementMiddleware) (*ManagementInterface, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start management interface listener: %w", err)
+	}
+
+	mi := &ManagementInterface{
+		listener:    ln,
+		username:    username,
+		password:    password,
+		subs:        make(map[EventKind][]chan Event),
+		replyChan:   make(chan string, 1),
+		middlewares: middlewares,
+	}
+
+	mi.wg.Add(1)
+	go mi.acceptAndServe()
+
+	return mi, nil
+}
+
+// ListenAddress returns the address OpenVPN's 'management' config
+// directive should point at.
+func (mi *ManagementInterface) ListenAddress() (net.IP, int, error) {
+	addr, ok := mi.listener.Addr().(*net.TCPAddr)
+	if !ok {
+		return nil, 0, fmt.Errorf("unexpected management interface listener address type")
+	}
+	return addr.IP, addr.Port, nil
+}
+
+// Subscribe registers a new subscriber for events of the given kind and
+// returns the channel it will be delivered on. The channel is closed
+// when StopManagementInterface is called, so subscribers should range
+// over it rather than reading it a single time.
+func (mi *ManagementInterface) Subscribe(kind EventKind) <-chan Event {
+	ch := make(chan Event, 16)
+
+	mi.subsMutex.Lock()
+	mi.subs[kind] = append(mi.subs[kind], ch)
+	mi.subsMutex.Unlock()
+
+	return ch
+}
+
+func (mi *ManagementInterface) acceptAndServe() {
+	defer mi.wg.Done()
+	// Runs on every exit path (Accept failure, a middleware failing to
+	// start, or the scan loop ending normally) so subscribers such as
+	// reconnect.go's state-event goroutine never block forever on a
+	// channel that's never going to receive or close.
+	defer mi.closeAllSubscribers()
+
+	conn, err := mi.listener.Accept()
+	if err != nil {
+		log.Error("management interface accept failed: ", err)
+		return
+	}
+
+	mi.cmdMutex.Lock()
+	mi.conn = conn
+	mi.cmdMutex.Unlock()
+
+	for _, mw := range mi.middlewares {
+		if err := mw.Start(conn); err != nil {
+			log.Error("management interface middleware failed to start: ", err)
+			conn.Close()
+			return
+		}
+	}
+
+	// capture route-add commands so Pause()/Resume() can undo/redo them
+	routeEvents := mi.Subscribe(EventLog)
+	mi.wg.Add(1)
+	go func() {
+		defer mi.wg.Done()
+		for ev := range routeEvents {
+			if strings.Contains(ev.Body, "route add ") || strings.Contains(ev.Body, "route ADD ") {
+				mi.subsMutex.Lock()
+				mi.routeAddCommands = append(mi.routeAddCommands, ev.Body)
+				mi.subsMutex.Unlock()
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		mi.processLine(scanner.Text())
+	}
+}
+
+// processLine routes one line received from the management interface.
+// It is first offered to the middleware chain, in registration order;
+// the first middleware to consume it stops the chain and the built-in
+// demuxer never sees the line. Otherwise, lines starting with '>' are
+// asynchronous notifications, split at the first ':' into (tag, body);
+// everything else is a synchronous command reply.
+func (mi *ManagementInterface) processLine(line string) {
+	for _, mw := range mi.middlewares {
+		consumed, err := mw.ConsumeLine(line)
+		if err != nil {
+			log.Error("management interface middleware failed to consume line: ", err)
+		}
+		if consumed {
+			return
+		}
+	}
+
+	if !strings.HasPrefix(line, ">") {
+		select {
+		case mi.replyChan <- line:
+		default:
+			log.Error("management interface: dropping unexpected reply line: ", line)
+		}
+		return
+	}
+
+	tag, body, found := strings.Cut(line[1:], ":")
+	if !found {
+		return
+	}
+
+	mi.dispatch(EventKind(tag), body)
+}
+
+func (mi *ManagementInterface) dispatch(kind EventKind, body string) {
+	mi.subsMutex.Lock()
+	defer mi.subsMutex.Unlock()
+
+	for _, ch := range mi.subs[kind] {
+		select {
+		case ch <- Event{Kind: kind, Body: body}:
+		default:
+			log.Error("management interface: subscriber for ", kind, " is not keeping up, dropping event")
+		}
+	}
+}
+
+func (mi *ManagementInterface) closeAllSubscribers() {
+	mi.subsMutex.Lock()
+	defer mi.subsMutex.Unlock()
+
+	for _, chans := range mi.subs {
+		for _, ch := range chans {
+			close(ch)
+		}
+	}
+	mi.subs = make(map[EventKind][]chan Event)
+}
+
+// send writes a command to the management socket. It does not wait for
+// the reply; use sendAndWait for commands whose synchronous reply
+// matters.
+func (mi *ManagementInterface) send(cmd string) error {
+	mi.cmdMutex.Lock()
+	conn := mi.conn
+	mi.cmdMutex.Unlock()
+
+	if conn == nil {
+		return fmt.Errorf("management interface is not connected")
+	}
+
+	_, err := fmt.Fprintf(conn, "%s\n", cmd)
+	return err
+}
+
+// sendAndWait writes a command and waits for its synchronous reply line.
+func (mi *ManagementInterface) sendAndWait(cmd string) (string, error) {
+	mi.cmdMutex.Lock()
+	defer mi.cmdMutex.Unlock()
+
+	conn := mi.conn
+	if conn == nil {
+		return "", fmt.Errorf("management interface is not connected")
+	}
+
+	if _, err := fmt.Fprintf(conn, "%s\n", cmd); err != nil {
+		return "", err
+	}
+
+	return <-mi.replyChan, nil
+}
+
+// SendDisconnect asks the OpenVPN process to shut down.
+func (mi *ManagementInterface) SendDisconnect() error {
+	return mi.send("signal SIGTERM")
+}
+
+// EnableBytecount turns on periodic ">BYTECOUNT:in,out" notifications,
+// emitted every interval. Subscribe(EventBytecount) to receive them.
+func (mi *ManagementInterface) EnableBytecount(interval int) error {
+	return mi.send(fmt.Sprintf("bytecount %d", interval))
+}
+
+// GetRouteAddCommands returns the 'route add' shell commands OpenVPN has
+// issued so far, so Pause()/Resume() can delete/restore them.
+func (mi *ManagementInterface) GetRouteAddCommands() []string {
+	mi.subsMutex.Lock()
+	defer mi.subsMutex.Unlock()
+	return mi.routeAddCommands
+}
+
+// StopManagementInterface closes the management socket and its listener
+// and closes every subscriber channel so subscriber goroutines can exit.
+func (mi *ManagementInterface) StopManagementInterface() error {
+	// stop middlewares before closing the socket, so their Stop can
+	// still write to it (e.g. 'bytecount 0')
+	for i := len(mi.middlewares) - 1; i >= 0; i-- {
+		if err := mi.middlewares[i].Stop(); err != nil {
+			log.Error("management interface middleware failed to stop: ", err)
+		}
+	}
+
+	mi.cmdMutex.Lock()
+	conn := mi.conn
+	mi.cmdMutex.Unlock()
+
+	if conn != nil {
+		if err := conn.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+
+	if err := mi.listener.Close(); err != nil {
+		return fmt.Errorf("failed to close management interface listener: %w", err)
+	}
+
+	mi.wg.Wait()
+
+	return nil
+}
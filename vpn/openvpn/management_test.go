@@ -0,0 +1,76 @@
+package openvpn
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// dialManagementInterface connects to mi's listener the way the OpenVPN
+// process would and returns the resulting connection.
+func dialManagementInterface(t *testing.T, mi *ManagementInterface) net.Conn {
+	t.Helper()
+
+	conn, err := net.DialTimeout("tcp", mi.listener.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to dial management interface: %v", err)
+	}
+	return conn
+}
+
+func TestManagementInterfaceDispatchesStateEvents(t *testing.T) {
+	mi, err := StartManagementInterface("user", "pass")
+	if err != nil {
+		t.Fatalf("StartManagementInterface failed: %v", err)
+	}
+	defer mi.StopManagementInterface()
+
+	events := mi.Subscribe(EventState)
+
+	conn := dialManagementInterface(t, mi)
+	defer conn.Close()
+
+	fmt.Fprintf(conn, ">STATE:1600000000,CONNECTED,SUCCESS,10.0.0.2,1.2.3.4,1194,,\n")
+
+	select {
+	case ev := <-events:
+		if ev.Kind != EventState {
+			t.Fatalf("unexpected event kind: %v", ev.Kind)
+		}
+		info, err := parseStateEvent(ev.Body)
+		if err != nil {
+			t.Fatalf("parseStateEvent failed: %v", err)
+		}
+		if info.ClientIP.String() != "10.0.0.2" {
+			t.Fatalf("unexpected client IP: %v", info.ClientIP)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for STATE event")
+	}
+}
+
+func TestManagementInterfaceClosesSubscribersOnStop(t *testing.T) {
+	mi, err := StartManagementInterface("user", "pass")
+	if err != nil {
+		t.Fatalf("StartManagementInterface failed: %v", err)
+	}
+
+	events := mi.Subscribe(EventBytecount)
+
+	conn := dialManagementInterface(t, mi)
+	defer conn.Close()
+
+	if err := mi.StopManagementInterface(); err != nil {
+		t.Fatalf("StopManagementInterface failed: %v", err)
+	}
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("expected subscriber channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for subscriber channel to close")
+	}
+}
@@ -0,0 +1,20 @@
+package openvpn
+
+import "net"
+
+// ManagementMiddleware lets third parties hook into the OpenVPN
+// management-interface connection without patching package openvpn:
+// bytecount collectors, custom auth-challenge responders,
+// connection-quality probes, session-billing hooks, etc.
+//
+// Start is called once the management socket is up, before any line is
+// read from it. ConsumeLine is offered every line read from the socket,
+// in registration order, before the built-in demuxer sees it; a
+// middleware that handles a line should return consumed=true so later
+// middlewares and the demuxer skip it. Stop is called on disconnect, in
+// reverse registration order.
+type ManagementMiddleware interface {
+	Start(conn net.Conn) error
+	Stop() error
+	ConsumeLine(line string) (consumed bool, err error)
+}
@@ -0,0 +1,81 @@
+package openvpn
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"ivpn/daemon/vpn"
+)
+
+// BytecountMiddleware is a built-in ManagementMiddleware that turns on
+// periodic ">BYTECOUNT:in,out" notifications on Start and forwards the
+// parsed totals to Updates. Modeled on mysteriumnetwork's
+// bytescount_client middleware.
+type BytecountMiddleware struct {
+	// Updates receives every RxBytes/TxBytes update. It is never closed
+	// by the middleware itself. An update is dropped (and logged) rather
+	// than blocking if Updates isn't keeping up, since ConsumeLine runs
+	// on the management interface's single line-reading goroutine.
+	Updates chan<- vpn.TrafficStats
+
+	intervalSeconds int
+	conn            net.Conn
+}
+
+// NewBytecountMiddleware creates a middleware that requests a bytecount
+// update every intervalSeconds and publishes it on updates.
+func NewBytecountMiddleware(intervalSeconds int, updates chan<- vpn.TrafficStats) *BytecountMiddleware {
+	return &BytecountMiddleware{Updates: updates, intervalSeconds: intervalSeconds}
+}
+
+// Start issues 'bytecount N' on conn to turn on periodic notifications.
+func (m *BytecountMiddleware) Start(conn net.Conn) error {
+	m.conn = conn
+
+	if _, err := fmt.Fprintf(conn, "bytecount %d\n", m.intervalSeconds); err != nil {
+		return fmt.Errorf("bytecount middleware: failed to enable notifications: %w", err)
+	}
+	return nil
+}
+
+// Stop turns periodic notifications back off.
+func (m *BytecountMiddleware) Stop() error {
+	if m.conn == nil {
+		return nil
+	}
+	if _, err := fmt.Fprintf(m.conn, "bytecount 0\n"); err != nil {
+		return fmt.Errorf("bytecount middleware: failed to disable notifications: %w", err)
+	}
+	return nil
+}
+
+// ConsumeLine intercepts '>BYTECOUNT:in,out' notifications.
+func (m *BytecountMiddleware) ConsumeLine(line string) (bool, error) {
+	body, found := strings.CutPrefix(line, ">BYTECOUNT:")
+	if !found {
+		return false, nil
+	}
+
+	cols := strings.SplitN(body, ",", 2)
+	if len(cols) != 2 {
+		return true, fmt.Errorf("bytecount middleware: failed to parse notification: %q", line)
+	}
+
+	rx, err := strconv.ParseInt(cols[0], 10, 64)
+	if err != nil {
+		return true, fmt.Errorf("bytecount middleware: failed to parse rx bytes: %w", err)
+	}
+	tx, err := strconv.ParseInt(cols[1], 10, 64)
+	if err != nil {
+		return true, fmt.Errorf("bytecount middleware: failed to parse tx bytes: %w", err)
+	}
+
+	select {
+	case m.Updates <- vpn.TrafficStats{RxBytes: rx, TxBytes: tx}:
+	default:
+		log.Error("bytecount middleware: consumer is not keeping up, dropping update")
+	}
+	return true, nil
+}
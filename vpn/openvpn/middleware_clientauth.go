@@ -0,0 +1,64 @@
+package openvpn
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ClientPendingAuthMiddleware is a built-in ManagementMiddleware that
+// answers OpenVPN's 'client-pending-auth' MFA/OTP prompts on behalf of
+// the user, by issuing a 'client-auth-nt' reply carrying the one-time
+// code supplied by Responder.
+type ClientPendingAuthMiddleware struct {
+	// Responder is called with the challenge text (the part of the
+	// '>CLIENT:CLIENT_AUTH_CHALLENGE' / 'client-pending-auth' line after
+	// the client ID) and must return the one-time code to answer
+	// with.
+	Responder func(challenge string) (string, error)
+
+	conn net.Conn
+}
+
+// NewClientPendingAuthMiddleware creates a middleware that answers
+// 'client-pending-auth' prompts using responder.
+func NewClientPendingAuthMiddleware(responder func(challenge string) (string, error)) *ClientPendingAuthMiddleware {
+	return &ClientPendingAuthMiddleware{Responder: responder}
+}
+
+// Start records conn so ConsumeLine can reply on it.
+func (m *ClientPendingAuthMiddleware) Start(conn net.Conn) error {
+	m.conn = conn
+	return nil
+}
+
+// Stop is a no-op: there is nothing to undo on disconnect.
+func (m *ClientPendingAuthMiddleware) Stop() error {
+	return nil
+}
+
+// ConsumeLine intercepts '>CLIENT:CLIENT_AUTH_CHALLENGE' notifications
+// and answers them with 'client-auth-nt'.
+func (m *ClientPendingAuthMiddleware) ConsumeLine(line string) (bool, error) {
+	body, found := strings.CutPrefix(line, ">CLIENT:CLIENT_AUTH_CHALLENGE,")
+	if !found {
+		return false, nil
+	}
+
+	cols := strings.SplitN(body, ",", 2)
+	if len(cols) != 2 {
+		return true, fmt.Errorf("client-pending-auth middleware: failed to parse challenge: %q", line)
+	}
+	clientID, challenge := cols[0], cols[1]
+
+	code, err := m.Responder(challenge)
+	if err != nil {
+		return true, fmt.Errorf("client-pending-auth middleware: responder failed: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(m.conn, "client-auth-nt %s\n%s\nEND\n", clientID, code); err != nil {
+		return true, fmt.Errorf("client-pending-auth middleware: failed to send reply: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,89 @@
+package openvpn
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"ivpn/daemon/vpn"
+)
+
+// fakeOpenVPNProcess pretends to be the OpenVPN process talking to a
+// management interface: it dials conn and lets the test script lines
+// to/from it.
+func fakeOpenVPNProcess(t *testing.T, addr string) (net.Conn, *bufio.Scanner) {
+	t.Helper()
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to dial fake MI socket: %v", err)
+	}
+	return conn, bufio.NewScanner(conn)
+}
+
+func TestBytecountMiddlewareReportsUpdates(t *testing.T) {
+	updates := make(chan vpn.TrafficStats, 1)
+	mw := NewBytecountMiddleware(5, updates)
+
+	mi, err := StartManagementInterface("user", "pass", mw)
+	if err != nil {
+		t.Fatalf("StartManagementInterface failed: %v", err)
+	}
+	defer mi.StopManagementInterface()
+
+	conn, scanner := fakeOpenVPNProcess(t, mi.listener.Addr().String())
+	defer conn.Close()
+
+	if !scanner.Scan() {
+		t.Fatal("expected 'bytecount 5' command from middleware Start")
+	}
+	if got := scanner.Text(); got != "bytecount 5" {
+		t.Fatalf("unexpected command: %q", got)
+	}
+
+	fmt.Fprintf(conn, ">BYTECOUNT:100,200\n")
+
+	select {
+	case stats := <-updates:
+		if stats.RxBytes != 100 || stats.TxBytes != 200 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for bytecount update")
+	}
+}
+
+func TestClientPendingAuthMiddlewareAnswersChallenge(t *testing.T) {
+	mw := NewClientPendingAuthMiddleware(func(challenge string) (string, error) {
+		if challenge != "please enter your OTP code" {
+			t.Fatalf("unexpected challenge: %q", challenge)
+		}
+		return "123456", nil
+	})
+
+	mi, err := StartManagementInterface("user", "pass", mw)
+	if err != nil {
+		t.Fatalf("StartManagementInterface failed: %v", err)
+	}
+	defer mi.StopManagementInterface()
+
+	conn, scanner := fakeOpenVPNProcess(t, mi.listener.Addr().String())
+	defer conn.Close()
+
+	fmt.Fprintf(conn, ">CLIENT:CLIENT_AUTH_CHALLENGE,1,please enter your OTP code\n")
+
+	if !scanner.Scan() {
+		t.Fatal("expected 'client-auth-nt' reply")
+	}
+	if got := scanner.Text(); got != "client-auth-nt 1" {
+		t.Fatalf("unexpected reply header: %q", got)
+	}
+	if !scanner.Scan() || scanner.Text() != "123456" {
+		t.Fatal("expected OTP code on second reply line")
+	}
+	if !scanner.Scan() || scanner.Text() != "END" {
+		t.Fatal("expected END terminator on reply")
+	}
+}
@@ -4,13 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"ivpn/daemon/logger"
-	"ivpn/daemon/obfsproxy"
-	"ivpn/daemon/service/platform"
+	"ivpn/daemon/pluggable"
 	"ivpn/daemon/shell"
 	"ivpn/daemon/vpn"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var log *logger.Logger
@@ -24,12 +25,12 @@ type OpenVPN struct {
 	binaryPath      string
 	configPath      string
 	logFile         string
-	isObfsProxy     bool
 	extraParameters string // user-defined extra-parameters of OpenVPN configuration
 	connectParams   ConnectionParams
 
 	managementInterface *ManagementInterface
-	obfsproxy           *obfsproxy.Obfsproxy
+	middlewares         []ManagementMiddleware
+	transport           pluggable.Transport
 
 	// current VPN state
 	state    vpn.State
@@ -42,6 +43,11 @@ type OpenVPN struct {
 	// No connection is possible anymore (to make new connection a new OpenVPN must be initialized).
 	// If we are in 'connecting' state - stop
 	isDisconnectRequested bool
+	// disconnectSignal is closed (once) the moment a disconnect is
+	// requested, so anything awaiting a candidate/backoff timer in the
+	// reconnect loop wakes up immediately instead of waiting it out.
+	disconnectSignal chan struct{}
+	disconnectOnce   sync.Once
 
 	// Note: Disconnect() function will wait until VPN fully disconnects
 	runningWG sync.WaitGroup
@@ -54,18 +60,19 @@ func NewOpenVpnObject(
 	binaryPath string,
 	configPath string,
 	logFile string,
-	isObfsProxy bool,
 	extraParameters string,
-	connectionParams ConnectionParams) (*OpenVPN, error) {
+	connectionParams ConnectionParams,
+	middlewares ...ManagementMiddleware) (*OpenVPN, error) {
 
 	return &OpenVPN{
-			state:           vpn.DISCONNECTED,
-			binaryPath:      binaryPath,
-			configPath:      configPath,
-			logFile:         logFile,
-			isObfsProxy:     isObfsProxy,
-			extraParameters: extraParameters,
-			connectParams:   connectionParams},
+			state:            vpn.DISCONNECTED,
+			binaryPath:       binaryPath,
+			configPath:       configPath,
+			logFile:          logFile,
+			extraParameters:  extraParameters,
+			connectParams:    connectionParams,
+			middlewares:      middlewares,
+			disconnectSignal: make(chan struct{})},
 		nil
 }
 
@@ -78,7 +85,15 @@ func (o *OpenVPN) DestinationIPs() []net.IP {
 	return o.connectParams.hostIPs
 }
 
-// Connect - SYNCHRONOUSLY execute openvpn process (wait untill it finished)
+// Connect supervises the whole connection lifetime: it iterates the
+// candidate endpoints built from connectParams.hostIPs and
+// connectParams.Fallbacks, cycling through them if there are fewer
+// candidates than maxReconnectAttempts, and retries with exponential
+// backoff after every attempt that fails - including a CONNECTED session
+// whose OpenVPN process exits with an error. It returns nil once an
+// attempt's OpenVPN process exits without an error, stops retrying once
+// Disconnect() is called, and returns an error once maxReconnectAttempts
+// attempts have failed.
 func (o *OpenVPN) Connect(stateChan chan<- vpn.StateInfo) (retErr error) {
 
 	// Note: Disconnect() function will wait until VPN fully disconnects
@@ -90,142 +105,117 @@ func (o *OpenVPN) Connect(stateChan chan<- vpn.StateInfo) (retErr error) {
 		return errors.New("disconnection already requested for this OpenVPN object. To make a new connection, please, initialize new one")
 	}
 
-	// it allows to wait till all routines finished
-	var routinesWaiter sync.WaitGroup
-	// marker to stop state-forward routine
-	stopStateChan := make(chan struct{})
-	// channel will be analyzed for state change. States will be forwarded to channel above ( to 'stateChan')
-	intarnalStateChan := make(chan vpn.StateInfo, 1)
-
-	// EXIT: stopping everything: Management interface, Obfsproxy
-	defer func() {
+	candidates := o.buildCandidates()
+	if len(candidates) == 0 {
+		return errors.New("unable to connect OpenVPN: no candidate endpoints configured")
+	}
 
-		if retErr != nil {
-			log.Error("Connection error: ", retErr)
+	backoff := reconnectInitialBackoff
+	var lastErr error
+	for attempt := 0; attempt < maxReconnectAttempts; attempt++ {
+		if o.isDisconnectRequested {
+			return nil
 		}
 
-		// stop state-forward routine
-		stopStateChan <- struct{}{}
+		if attempt > 0 {
+			stateChan <- vpn.StateInfo{State: vpn.RECONNECTING_FALLBACK}
 
-		mi := o.managementInterface
-		if mi != nil {
-			if err := mi.StopManagementInterface(); err != nil {
-				log.Error(err)
+			if !o.sleepOrDisconnect(backoff) {
+				return nil
+			}
+			backoff *= 2
+			if backoff > reconnectMaxBackoff {
+				backoff = reconnectMaxBackoff
 			}
 		}
 
-		obfspxy := o.obfsproxy
-		if obfspxy != nil {
-			obfspxy.Stop()
+		candidate := candidates[attempt%len(candidates)]
+		lastErr = o.connectToCandidate(candidate, stateChan)
+		if lastErr == nil || o.isDisconnectRequested {
+			return lastErr
 		}
 
-		o.obfsproxy = nil
+		log.Error("connection attempt failed, advancing to next candidate: ", lastErr)
+	}
 
-		if err := o.implOnDisconnected(); err != nil {
-			log.Error(err)
-		}
+	return fmt.Errorf("failed to connect after %d attempts, last error: %w", maxReconnectAttempts, lastErr)
+}
 
-		// wait till all routines finished
-		routinesWaiter.Wait()
-	}()
+// parseStateEvent converts the body of a '>STATE' notification
+// ("timestamp,state,...") into a vpn.StateInfo.
+func parseStateEvent(body string) (vpn.StateInfo, error) {
+	cols := strings.SplitN(body, ",", 5)
+	if len(cols) < 2 {
+		return vpn.StateInfo{}, fmt.Errorf("failed to parse '>STATE' notification: %q", body)
+	}
 
-	// analyse and forward state changes
-	routinesWaiter.Add(1)
-	go func() {
-		defer routinesWaiter.Done()
-
-		var stateInf vpn.StateInfo
-		for {
-			select {
-			case stateInf = <-intarnalStateChan:
-				// save current state
-				o.state = stateInf.State
-
-				// forward state
-				stateChan <- stateInf
-
-				if o.state == vpn.CONNECTED {
-					o.clientIP = stateInf.ClientIP
-					o.implOnConnected() // process "on connected" event (if necessary)
-				} else {
-					o.clientIP = nil
-				}
-
-			case <-stopStateChan: // openvpn process stopped
-				return // stop goroutine
-			}
+	stateInf := vpn.StateInfo{}
+	switch cols[1] {
+	case "CONNECTED":
+		stateInf.State = vpn.CONNECTED
+		if len(cols) >= 4 {
+			stateInf.ClientIP = net.ParseIP(cols[3])
 		}
-	}()
-
-	if o.managementInterface != nil {
-		return errors.New("unable to connect OpenVPN. Management interface already initialized")
+	case "RECONNECTING":
+		stateInf.State = vpn.RECONNECTING
+	default:
+		stateInf.State = vpn.CONNECTING
 	}
 
-	var err error
-	obfsproxyPort := 0
-	// start Obfsproxy (if necessary)
-	if o.isObfsProxy {
-		o.obfsproxy = obfsproxy.CreateObfsproxy(platform.ObfsproxyStartScript())
-		if obfsproxyPort, err = o.obfsproxy.Start(); err != nil {
-			return errors.New("unable to initialize OpenVPN (obfsproxy not started): " + err.Error())
-		}
+	return stateInf, nil
+}
 
-		// detect opbfsproxy ptocess stop
-		routinesWaiter.Add(1)
-		go func() {
-			defer routinesWaiter.Done()
+// EnableBytecount turns on periodic RxBytes/TxBytes notifications on the
+// management interface and returns a channel delivering the running
+// totals every interval. Must be called while Connect is running and the
+// current attempt has a management interface (e.g. from a state-change
+// handler watching for vpn.CONNECTING); when that attempt ends its
+// management interface is stopped and the returned channel is closed.
+func (o *OpenVPN) EnableBytecount(interval time.Duration) (<-chan vpn.TrafficStats, error) {
+	mi := o.managementInterface
+	if mi == nil {
+		return nil, errors.New("OpenVPN MI is nil")
+	}
 
-			opxy := o.obfsproxy
-			if opxy == nil {
-				return
-			}
+	bytecountEvents := mi.Subscribe(EventBytecount)
+	if err := mi.EnableBytecount(int(interval.Seconds())); err != nil {
+		return nil, fmt.Errorf("failed to enable bytecount notifications: %w", err)
+	}
 
-			// wait for obfsproxy stop
-			opxy.Wait()
-			if o.isDisconnectRequested == false {
-				// If obfsproxy stopped unexpectedly - disconnect VPN
-				log.Error("Obfsproxy stopped unexpectedly. Disconnecting VPN...")
-				o.doDisconnect()
+	out := make(chan vpn.TrafficStats, 1)
+	go func() {
+		defer close(out)
+		for ev := range bytecountEvents {
+			stats, err := parseBytecountEvent(ev.Body)
+			if err != nil {
+				log.Error(err)
+				continue
 			}
-		}()
-	}
+			out <- stats
+		}
+	}()
 
-	// start new management interface
-	mi, err := StartManagementInterface(o.connectParams.username, o.connectParams.password, intarnalStateChan)
-	if err != nil {
-		return fmt.Errorf("failed to start MI: %w", err)
-	}
-	o.managementInterface = mi
+	return out, nil
+}
 
-	if o.isDisconnectRequested {
-		// If the disconnection request received immediately after 'connect' request - stop connection after MI is initialized
-		log.Info("Connection process cancelled.")
-		return nil
+// parseBytecountEvent converts the body of a '>BYTECOUNT' notification
+// ("rxBytes,txBytes") into a vpn.TrafficStats.
+func parseBytecountEvent(body string) (vpn.TrafficStats, error) {
+	cols := strings.SplitN(body, ",", 2)
+	if len(cols) != 2 {
+		return vpn.TrafficStats{}, fmt.Errorf("failed to parse '>BYTECOUNT' notification: %q", body)
 	}
 
-	miIP, miPort, err := mi.ListenAddress()
+	rx, err := strconv.ParseInt(cols[0], 10, 64)
 	if err != nil {
-		return fmt.Errorf("failed to start MI listener: %w", err)
+		return vpn.TrafficStats{}, fmt.Errorf("failed to parse '>BYTECOUNT' rx bytes: %w", err)
 	}
-
-	// create config file
-	err = o.connectParams.WriteConfigFile(
-		o.configPath,
-		miIP, miPort,
-		o.logFile,
-		obfsproxyPort,
-		o.extraParameters)
-
+	tx, err := strconv.ParseInt(cols[1], 10, 64)
 	if err != nil {
-		return fmt.Errorf("failed to write configuration file: %w", err)
-	}
-
-	// SYNCHRONOUSLY execute openvpn process (wait untill it finished)
-	if err = shell.Exec(log, o.binaryPath, "--config", o.configPath); err != nil {
-		return fmt.Errorf("failed to start OpenVPN process: %w", err)
+		return vpn.TrafficStats{}, fmt.Errorf("failed to parse '>BYTECOUNT' tx bytes: %w", err)
 	}
 
-	return nil
+	return vpn.TrafficStats{RxBytes: rx, TxBytes: tx}, nil
 }
 
 // Disconnect stops the connection
@@ -247,6 +237,7 @@ func (o *OpenVPN) doDisconnect() error {
 	// there is a chance we are in 'connecting' state, but managementInterface is not defined yet
 	// Therefore, we are saving our intention to disconnect
 	o.isDisconnectRequested = true
+	o.disconnectOnce.Do(func() { close(o.disconnectSignal) })
 
 	mi := o.managementInterface
 	if mi == nil {
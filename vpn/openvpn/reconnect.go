@@ -0,0 +1,280 @@
+package openvpn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"ivpn/daemon/pluggable"
+	"ivpn/daemon/pluggable/kcp"
+	"ivpn/daemon/pluggable/obfs4"
+	"ivpn/daemon/pluggable/quic"
+	"ivpn/daemon/shell"
+	"ivpn/daemon/vpn"
+)
+
+// These are declared as vars, rather than consts, so tests can shrink
+// them to keep the failover/backoff state machine in reconnect_test.go
+// fast; production code should leave them at their defaults below.
+var (
+	// maxReconnectAttempts bounds how many candidates Connect() will try
+	// (cycling through the candidate list if there are fewer candidates
+	// than attempts) before giving up.
+	maxReconnectAttempts = 5
+	// reconnectInitialBackoff/reconnectMaxBackoff bound the exponential
+	// backoff applied between failed attempts.
+	reconnectInitialBackoff = 2 * time.Second
+	reconnectMaxBackoff     = 32 * time.Second
+	// connectTimeout is how long a single attempt waits to observe
+	// CONNECTED on the management interface before it's considered a
+	// failed candidate.
+	connectTimeout = 20 * time.Second
+)
+
+// buildCandidates returns the ordered list of endpoints Connect() should
+// try: one per o.connectParams.hostIPs (using the primary obfuscation
+// settings), followed by o.connectParams.Fallbacks.
+func (o *OpenVPN) buildCandidates() []Endpoint {
+	candidates := make([]Endpoint, 0, len(o.connectParams.hostIPs)+len(o.connectParams.Fallbacks))
+
+	for _, host := range o.connectParams.hostIPs {
+		candidates = append(candidates, Endpoint{
+			Host:                 host,
+			Port:                 o.connectParams.Port,
+			ObfuscationMode:      o.connectParams.ObfuscationMode,
+			ObfsRemotePort:       o.connectParams.ObfsRemotePort,
+			ObfsBridge:           o.connectParams.ObfsBridge,
+			KCPPresharedKey:      o.connectParams.KCPPresharedKey,
+			QUICServerCertSHA256: o.connectParams.QUICServerCertSHA256,
+		})
+	}
+
+	return append(candidates, o.connectParams.Fallbacks...)
+}
+
+// newTransportFor creates the pluggable.Transport selected by ep's
+// obfuscation mode. Callers must call Start() on the result before
+// using it.
+func (o *OpenVPN) newTransportFor(ep Endpoint) (pluggable.Transport, error) {
+	switch ep.ObfuscationMode {
+	case Obfs4:
+		if ep.ObfsBridge == nil {
+			return nil, errors.New("obfs4 obfuscation requested but no bridge parameters provided")
+		}
+		return obfs4.NewClient(*ep.ObfsBridge), nil
+	case QUIC:
+		return quic.NewClient(ep.QUICServerCertSHA256), nil
+	case KCP:
+		return kcp.NewClient(ep.KCPPresharedKey), nil
+	default:
+		return nil, fmt.Errorf("unsupported obfuscation mode: %v", ep.ObfuscationMode)
+	}
+}
+
+// sleepOrDisconnect waits for d to elapse, returning true, or returns
+// false as soon as a disconnect is requested - whichever happens first.
+func (o *OpenVPN) sleepOrDisconnect(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-o.disconnectSignal:
+		return false
+	}
+}
+
+// connectToCandidate runs a single connection attempt against ep: it
+// starts the pluggable transport (if any), the management interface and
+// the OpenVPN process, waits up to connectTimeout to observe CONNECTED,
+// and then - once connected - blocks until the process exits or
+// Disconnect() is called. A non-nil error means the attempt failed - it
+// did not reach CONNECTED, or the OpenVPN process of a CONNECTED session
+// exited with an error - and the caller should advance to the next
+// candidate.
+func (o *OpenVPN) connectToCandidate(ep Endpoint, stateChan chan<- vpn.StateInfo) (retErr error) {
+	if o.managementInterface != nil {
+		return errors.New("unable to connect OpenVPN. Management interface already initialized")
+	}
+
+	// it allows to wait till all routines finished
+	var routinesWaiter sync.WaitGroup
+	// marker to stop state-forward routine
+	stopStateChan := make(chan struct{})
+	// channel will be analyzed for state change. States will be forwarded to channel above ( to 'stateChan')
+	intarnalStateChan := make(chan vpn.StateInfo, 1)
+	// closed once when the candidate reaches CONNECTED
+	connectedChan := make(chan struct{})
+	var connectedOnce sync.Once
+
+	// EXIT: stopping everything: Management interface, pluggable transport
+	defer func() {
+		if retErr != nil {
+			log.Error("Connection error: ", retErr)
+		}
+
+		// stop state-forward routine
+		stopStateChan <- struct{}{}
+
+		mi := o.managementInterface
+		if mi != nil {
+			if err := mi.StopManagementInterface(); err != nil {
+				log.Error(err)
+			}
+		}
+		o.managementInterface = nil
+
+		tr := o.transport
+		if tr != nil {
+			if err := tr.Stop(); err != nil {
+				log.Error(err)
+			}
+		}
+		o.transport = nil
+
+		if err := o.implOnDisconnected(); err != nil {
+			log.Error(err)
+		}
+
+		// wait till all routines finished
+		routinesWaiter.Wait()
+	}()
+
+	// analyse and forward state changes
+	routinesWaiter.Add(1)
+	go func() {
+		defer routinesWaiter.Done()
+
+		var stateInf vpn.StateInfo
+		for {
+			select {
+			case stateInf = <-intarnalStateChan:
+				// save current state
+				o.state = stateInf.State
+
+				// forward state
+				stateChan <- stateInf
+
+				if o.state == vpn.CONNECTED {
+					o.clientIP = stateInf.ClientIP
+					o.implOnConnected() // process "on connected" event (if necessary)
+					connectedOnce.Do(func() { close(connectedChan) })
+				} else {
+					o.clientIP = nil
+				}
+
+			case <-stopStateChan: // openvpn process stopped
+				return // stop goroutine
+			}
+		}
+	}()
+
+	localProxyPort := 0
+	// start the pluggable transport (if this candidate requires obfuscation)
+	if ep.ObfuscationMode != None {
+		transport, err := o.newTransportFor(ep)
+		if err != nil {
+			return fmt.Errorf("unable to initialize OpenVPN (pluggable transport not started): %w", err)
+		}
+
+		remoteAddr := fmt.Sprintf("%s:%d", ep.Host.String(), ep.ObfsRemotePort)
+		if err := transport.Start(remoteAddr); err != nil {
+			return fmt.Errorf("unable to initialize OpenVPN (pluggable transport not started): %w", err)
+		}
+		o.transport = transport
+
+		localProxyPort = o.transport.ListenAddress().(*net.TCPAddr).Port
+	}
+
+	// start new management interface
+	mi, err := StartManagementInterface(o.connectParams.username, o.connectParams.password, o.middlewares...)
+	if err != nil {
+		return fmt.Errorf("failed to start MI: %w", err)
+	}
+	o.managementInterface = mi
+
+	// demultiplex '>STATE' notifications into intarnalStateChan
+	stateEvents := mi.Subscribe(EventState)
+	routinesWaiter.Add(1)
+	go func() {
+		defer routinesWaiter.Done()
+
+		for ev := range stateEvents {
+			stateInf, err := parseStateEvent(ev.Body)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			intarnalStateChan <- stateInf
+		}
+	}()
+
+	if o.isDisconnectRequested {
+		// If the disconnection request received immediately after 'connect' request - stop connection after MI is initialized
+		log.Info("Connection process cancelled.")
+		return nil
+	}
+
+	miIP, miPort, err := mi.ListenAddress()
+	if err != nil {
+		return fmt.Errorf("failed to start MI listener: %w", err)
+	}
+
+	// create config file
+	err = o.connectParams.WriteConfigFile(
+		o.configPath,
+		miIP, miPort,
+		o.logFile,
+		ep.Host, ep.Port,
+		localProxyPort,
+		o.extraParameters)
+
+	if err != nil {
+		return fmt.Errorf("failed to write configuration file: %w", err)
+	}
+
+	// run the openvpn process on its own goroutine so we can race it
+	// against the connect timeout and a disconnect request
+	processExitChan := make(chan error, 1)
+	go func() {
+		processExitChan <- shell.Exec(log, o.binaryPath, "--config", o.configPath)
+	}()
+
+	// wait for CONNECTED, honouring every await point so Disconnect()
+	// unblocks promptly even if this candidate never comes up
+	select {
+	case err := <-processExitChan:
+		if err != nil {
+			return fmt.Errorf("OpenVPN process exited: %w", err)
+		}
+		return nil
+
+	case <-connectedChan:
+		// fully connected - wait for the session to end
+		return o.waitForSessionEnd(processExitChan)
+
+	case <-time.After(connectTimeout):
+		if err := mi.SendDisconnect(); err != nil {
+			log.Error(err)
+		}
+		<-processExitChan
+		return fmt.Errorf("timed out waiting for CONNECTED state after %s", connectTimeout)
+
+	case <-o.disconnectSignal:
+		// doDisconnect() already asked the MI to disconnect; wait
+		// for the process to actually exit before returning, same
+		// as a normal connected session would.
+		<-processExitChan
+		return nil
+	}
+}
+
+// waitForSessionEnd blocks until the already-CONNECTED OpenVPN process
+// exits, which happens either because the user disconnected or because
+// the connection was lost.
+func (o *OpenVPN) waitForSessionEnd(processExitChan <-chan error) error {
+	if err := <-processExitChan; err != nil {
+		return fmt.Errorf("OpenVPN process exited: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package openvpn
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"ivpn/daemon/vpn"
+)
+
+// writeFakeOpenVPNBinary writes a script that just sleeps for d, standing
+// in for an OpenVPN process that never dials the management interface
+// (and so never reaches CONNECTED), to drive the connect-timeout path in
+// connectToCandidate without a real OpenVPN binary.
+func writeFakeOpenVPNBinary(t *testing.T, d time.Duration) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("fake OpenVPN binary is a shell script")
+	}
+
+	path := filepath.Join(t.TempDir(), "fake-openvpn.sh")
+	script := fmt.Sprintf("#!/bin/sh\nsleep %f\n", d.Seconds())
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake openvpn binary: %v", err)
+	}
+	return path
+}
+
+func TestBuildCandidatesIncludesFallbacks(t *testing.T) {
+	o := &OpenVPN{
+		connectParams: ConnectionParams{
+			hostIPs:        []net.IP{net.ParseIP("10.0.0.1")},
+			ObfsRemotePort: 443,
+			Fallbacks: []Endpoint{
+				{Host: net.ParseIP("10.0.0.2"), ObfsRemotePort: 443, ObfuscationMode: QUIC},
+			},
+		},
+	}
+
+	candidates := o.buildCandidates()
+	if len(candidates) != 2 {
+		t.Fatalf("expected 2 candidates, got %d", len(candidates))
+	}
+	if !candidates[0].Host.Equal(net.ParseIP("10.0.0.1")) {
+		t.Fatalf("unexpected first candidate: %+v", candidates[0])
+	}
+	if candidates[1].ObfuscationMode != QUIC {
+		t.Fatalf("expected fallback to keep its obfuscation mode, got %v", candidates[1].ObfuscationMode)
+	}
+}
+
+func TestBuildCandidatesUsesRealPortForDirectConnections(t *testing.T) {
+	o := &OpenVPN{
+		connectParams: ConnectionParams{
+			hostIPs:        []net.IP{net.ParseIP("10.0.0.1")},
+			Port:           1194,
+			ObfsRemotePort: 443, // should be ignored: ObfuscationMode is None
+		},
+	}
+
+	candidates := o.buildCandidates()
+	if len(candidates) != 1 {
+		t.Fatalf("expected 1 candidate, got %d", len(candidates))
+	}
+	if candidates[0].Port != 1194 {
+		t.Fatalf("expected direct candidate to use the real server port, got %d", candidates[0].Port)
+	}
+}
+
+func TestSleepOrDisconnectWakesOnDisconnect(t *testing.T) {
+	o := &OpenVPN{disconnectSignal: make(chan struct{})}
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- o.sleepOrDisconnect(reconnectMaxBackoff)
+	}()
+
+	close(o.disconnectSignal)
+
+	if woke := <-done; woke {
+		t.Fatal("expected sleepOrDisconnect to report interruption, not a full sleep")
+	}
+}
+
+// TestConnectAdvancesOnTimeoutAndExhaustsAttempts drives Connect() against
+// a candidate whose OpenVPN process never dials the management interface
+// (and so never reaches CONNECTED): every attempt should fail on
+// connectTimeout, advance to the next candidate, back off, and - once
+// maxReconnectAttempts is spent - Connect() should return the
+// exhausted-attempts error.
+func TestConnectAdvancesOnTimeoutAndExhaustsAttempts(t *testing.T) {
+	origMaxAttempts, origInitialBackoff, origMaxBackoff, origConnectTimeout :=
+		maxReconnectAttempts, reconnectInitialBackoff, reconnectMaxBackoff, connectTimeout
+	defer func() {
+		maxReconnectAttempts, reconnectInitialBackoff, reconnectMaxBackoff, connectTimeout =
+			origMaxAttempts, origInitialBackoff, origMaxBackoff, origConnectTimeout
+	}()
+	maxReconnectAttempts = 2
+	reconnectInitialBackoff = 10 * time.Millisecond
+	reconnectMaxBackoff = 10 * time.Millisecond
+	connectTimeout = 100 * time.Millisecond
+
+	binaryPath := writeFakeOpenVPNBinary(t, 300*time.Millisecond)
+
+	o, err := NewOpenVpnObject(
+		binaryPath,
+		filepath.Join(t.TempDir(), "fake.ovpn"),
+		"",
+		"",
+		NewConnectionParams("user", "pass", []net.IP{net.ParseIP("10.0.0.1")}, 1194, nil),
+	)
+	if err != nil {
+		t.Fatalf("NewOpenVpnObject failed: %v", err)
+	}
+
+	stateChan := make(chan vpn.StateInfo, 16)
+	done := make(chan error, 1)
+	go func() { done <- o.Connect(stateChan) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected Connect to fail after exhausting attempts, got nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Connect to exhaust its attempts")
+	}
+
+	sawReconnecting := false
+	for {
+		select {
+		case info := <-stateChan:
+			if info.State == vpn.RECONNECTING_FALLBACK {
+				sawReconnecting = true
+			}
+			continue
+		default:
+		}
+		break
+	}
+	if !sawReconnecting {
+		t.Fatal("expected Connect to report RECONNECTING_FALLBACK when advancing to the next candidate")
+	}
+}